@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/max747/fgojunks/jpeger/internal/jpegenc"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+func TestResolveDestPath(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{"photo.png", "photo.jpg"},
+		{"photo.jpg", "photo.jpg"},
+		{"photo.jpeg", "photo.jpeg"},
+		{"album.zip", "album_jpeg.zip"},
+		{"album.tar", "album_jpeg.tar"},
+		{"album.tgz", "album_jpeg.tgz"},
+		{"album.tar.gz", "album_jpeg.tar.gz"},
+		{"ALBUM.TAR.GZ", "ALBUM_jpeg.tar.gz"},
+	}
+	for _, c := range cases {
+		if got := resolveDestPath(c.src); got != c.want {
+			t.Errorf("resolveDestPath(%q) = %q; want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func newTestOpts() convertOptions {
+	return convertOptions{
+		parallelism: 2,
+		encoder:     jpegenc.New(),
+		encOpts:     jpegenc.Options{Quality: 90, Subsampling: jpegenc.Subsample420},
+		pool:        newPool(2),
+	}
+}
+
+func encodeTestPNG(t *testing.T, c color.RGBA) []byte {
+	t.Helper()
+	im := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			im.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, im); err != nil {
+		t.Fatalf("png.Encode: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvertZipItemsPreservesOrder(t *testing.T) {
+	names := []string{"1.png", "2.png", "3.png"}
+	colors := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for i, name := range names {
+		wf, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zw.Create: %s", err)
+		}
+		if _, err := wf.Write(encodeTestPNG(t, colors[i])); err != nil {
+			t.Fatalf("wf.Write: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %s", err)
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "album.zip")
+	if err := os.WriteFile(srcPath, zipBuf.Bytes(), 0644); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+	destPath := filepath.Join(dir, "album_jpeg.zip")
+
+	opts := newTestOpts()
+	defer opts.pool.close()
+	if err := convertZipItems(srcPath, destPath, opts); err != nil {
+		t.Fatalf("convertZipItems: %s", err)
+	}
+
+	r, err := zip.OpenReader(destPath)
+	if err != nil {
+		t.Fatalf("zip.OpenReader: %s", err)
+	}
+	defer r.Close()
+
+	if len(r.File) != len(names) {
+		t.Fatalf("got %d entries; want %d", len(r.File), len(names))
+	}
+	want := []string{"1.jpg", "2.jpg", "3.jpg"}
+	for i, f := range r.File {
+		if f.Name != want[i] {
+			t.Errorf("entry %d name = %q; want %q", i, f.Name, want[i])
+		}
+	}
+}
+
+func TestConvertTarItemsPreservesOrder(t *testing.T) {
+	names := []string{"1.png", "2.png", "3.png"}
+	colors := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i, name := range names {
+		data := encodeTestPNG(t, colors[i])
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tw.WriteHeader: %s", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatalf("tw.Write: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tw.Close: %s", err)
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "album.tar")
+	if err := os.WriteFile(srcPath, tarBuf.Bytes(), 0644); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+	destPath := filepath.Join(dir, "album_jpeg.tar")
+
+	opts := newTestOpts()
+	defer opts.pool.close()
+	if err := convertTarItems(srcPath, destPath, opts, false); err != nil {
+		t.Fatalf("convertTarItems: %s", err)
+	}
+
+	f, err := os.Open(destPath)
+	if err != nil {
+		t.Fatalf("os.Open: %s", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	want := []string{"1.jpg", "2.jpg", "3.jpg"}
+	var got []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, hdr.Name)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d name = %q; want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestConvertTarGzItemsWritesGzippedTar(t *testing.T) {
+	data := encodeTestPNG(t, color.RGBA{R: 255, A: 255})
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	hdr := &tar.Header{Name: "1.png", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("tw.WriteHeader: %s", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatalf("tw.Write: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tw.Close: %s", err)
+	}
+
+	var gzBuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzBuf)
+	if _, err := gzw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatalf("gzw.Write: %s", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("gzw.Close: %s", err)
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "album.tar.gz")
+	if err := os.WriteFile(srcPath, gzBuf.Bytes(), 0644); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+	destPath := filepath.Join(dir, "album_jpeg.tar.gz")
+
+	opts := newTestOpts()
+	defer opts.pool.close()
+	if err := convertTarItems(srcPath, destPath, opts, true); err != nil {
+		t.Fatalf("convertTarItems: %s", err)
+	}
+
+	f, err := os.Open(destPath)
+	if err != nil {
+		t.Fatalf("os.Open: %s", err)
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %s", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	hdr, err = tr.Next()
+	if err != nil {
+		t.Fatalf("tr.Next: %s", err)
+	}
+	if hdr.Name != "1.jpg" {
+		t.Errorf("entry name = %q; want %q", hdr.Name, "1.jpg")
+	}
+}
@@ -0,0 +1,32 @@
+// Package jpegenc abstracts over JPEG encoder backends so that jpeger can
+// swap the standard library's image/jpeg for a faster, more configurable
+// encoder without touching its callers.
+package jpegenc
+
+import (
+	"bytes"
+	"image"
+)
+
+// Subsampling identifies a chroma subsampling ratio.
+type Subsampling string
+
+const (
+	Subsample444 Subsampling = "4:4:4"
+	Subsample422 Subsampling = "4:2:2"
+	Subsample420 Subsampling = "4:2:0"
+)
+
+// Options configures an Encoder's output. Not every backend honors every
+// field; see the individual Encoder implementations.
+type Options struct {
+	Quality        int
+	Subsampling    Subsampling
+	Progressive    bool
+	OptimizeCoding bool
+}
+
+// Encoder turns a decoded image into JPEG-encoded bytes.
+type Encoder interface {
+	Encode(im image.Image, opts Options) (*bytes.Buffer, error)
+}
@@ -0,0 +1,80 @@
+//go:build libjpeg
+
+package jpegenc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+
+	libjpeg "github.com/pixiv/go-libjpeg/jpeg"
+)
+
+// New returns an Encoder backed by github.com/pixiv/go-libjpeg/jpeg, which
+// is faster than the standard library's image/jpeg and exposes progressive
+// output and coding optimization that it doesn't.
+func New() Encoder {
+	return libjpegEncoder{}
+}
+
+type libjpegEncoder struct{}
+
+func (libjpegEncoder) Encode(im image.Image, opts Options) (*bytes.Buffer, error) {
+	encOpts := libjpeg.EncoderOptions{
+		Quality:         opts.Quality,
+		OptimizeCoding:  opts.OptimizeCoding,
+		ProgressiveMode: opts.Progressive,
+		DCTMethod:       libjpeg.DCTISlow,
+	}
+
+	// go-libjpeg takes chroma subsampling from the SubsampleRatio of the
+	// *image.YCbCr it's given rather than from EncoderOptions, so relabel
+	// or convert im to match opts.Subsampling before handing it off.
+	ycc := prepareYCbCr(im, opts.Subsampling)
+
+	buf := new(bytes.Buffer)
+	if err := libjpeg.Encode(buf, ycc, &encOpts); err != nil {
+		return nil, fmt.Errorf("libjpeg.Encode: %w", err)
+	}
+	return buf, nil
+}
+
+// prepareYCbCr returns im as a *image.YCbCr sampled at the ratio s asks for,
+// passing it through unconverted when it already is one.
+func prepareYCbCr(im image.Image, s Subsampling) *image.YCbCr {
+	ratio := subsampleRatio(s)
+	if ycc, ok := im.(*image.YCbCr); ok && ycc.SubsampleRatio == ratio {
+		return ycc
+	}
+	return toYCbCr(im, ratio)
+}
+
+func subsampleRatio(s Subsampling) image.YCbCrSubsampleRatio {
+	switch s {
+	case Subsample444:
+		return image.YCbCrSubsampleRatio444
+	case Subsample422:
+		return image.YCbCrSubsampleRatio422
+	default:
+		return image.YCbCrSubsampleRatio420
+	}
+}
+
+// toYCbCr converts im to a *image.YCbCr sampled at ratio. Used whenever im
+// isn't already a YCbCr image at the requested ratio, e.g. decoded PNGs or a
+// source JPEG that was subsampled differently than opts.Subsampling asks for.
+func toYCbCr(im image.Image, ratio image.YCbCrSubsampleRatio) *image.YCbCr {
+	b := im.Bounds()
+	dst := image.NewYCbCr(b, ratio)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.YCbCrModel.Convert(im.At(x, y)).(color.YCbCr)
+			dst.Y[dst.YOffset(x, y)] = c.Y
+			ci := dst.COffset(x, y)
+			dst.Cb[ci] = c.Cb
+			dst.Cr[ci] = c.Cr
+		}
+	}
+	return dst
+}
@@ -0,0 +1,69 @@
+//go:build libjpeg
+
+package jpegenc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPrepareYCbCrPassthroughOnMatchingRatio(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	got := prepareYCbCr(src, Subsample420)
+	if got != src {
+		t.Error("matching ratio should pass the same image through unconverted")
+	}
+}
+
+func TestPrepareYCbCrConvertsOnMismatchedRatio(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	got := prepareYCbCr(src, Subsample444)
+	if got == src {
+		t.Error("mismatched ratio should return a converted copy, not the original")
+	}
+	if got.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+		t.Errorf("SubsampleRatio = %v; want 4:4:4", got.SubsampleRatio)
+	}
+}
+
+func TestPrepareYCbCrConvertsNonYCbCrInput(t *testing.T) {
+	// Every pixel is the same color so that a chroma-subsampled group
+	// (multiple luma samples sharing one Cb/Cr pair) has only one possible
+	// value to compare against, regardless of which sample in the group
+	// toYCbCr's conversion loop happens to write last.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	got := prepareYCbCr(src, Subsample422)
+	if got.SubsampleRatio != image.YCbCrSubsampleRatio422 {
+		t.Errorf("SubsampleRatio = %v; want 4:2:2", got.SubsampleRatio)
+	}
+
+	want := color.YCbCrModel.Convert(src.At(0, 0)).(color.YCbCr)
+	gotC := color.YCbCr{Y: got.Y[got.YOffset(0, 0)], Cb: got.Cb[got.COffset(0, 0)], Cr: got.Cr[got.COffset(0, 0)]}
+	if gotC != want {
+		t.Errorf("converted pixel = %+v; want %+v", gotC, want)
+	}
+}
+
+func TestSubsampleRatio(t *testing.T) {
+	cases := []struct {
+		in   Subsampling
+		want image.YCbCrSubsampleRatio
+	}{
+		{Subsample444, image.YCbCrSubsampleRatio444},
+		{Subsample422, image.YCbCrSubsampleRatio422},
+		{Subsample420, image.YCbCrSubsampleRatio420},
+		{Subsampling("bogus"), image.YCbCrSubsampleRatio420},
+	}
+	for _, c := range cases {
+		if got := subsampleRatio(c.in); got != c.want {
+			t.Errorf("subsampleRatio(%q) = %v; want %v", c.in, got, c.want)
+		}
+	}
+}
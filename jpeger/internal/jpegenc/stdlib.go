@@ -0,0 +1,28 @@
+//go:build !libjpeg
+
+package jpegenc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// New returns the default Encoder, backed by the standard library's
+// image/jpeg package. It always writes baseline 4:2:0 and ignores
+// Subsampling, Progressive and OptimizeCoding, since image/jpeg exposes no
+// control over them beyond Quality.
+func New() Encoder {
+	return stdlibEncoder{}
+}
+
+type stdlibEncoder struct{}
+
+func (stdlibEncoder) Encode(im image.Image, opts Options) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, im, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, fmt.Errorf("jpeg.Encode: %w", err)
+	}
+	return buf, nil
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"flag"
 	"fmt"
 	"image"
-	"image/jpeg"
+	// image/jpeg must be imported here, not just by the stdlib jpegenc
+	// backend, so that image.Decode can still read JPEG input (JPEG entries
+	// inside zip/tar archives) when built with -tags libjpeg, since
+	// go-libjpeg/jpeg doesn't register itself as an image.Decode format.
+	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"io/fs"
@@ -13,11 +18,28 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/text/encoding/japanese"
+
+	"github.com/max747/fgojunks/jpeger/internal/jpegenc"
 )
 
+// convertOptions bundles together the per-run knobs that every conversion
+// path (single file, directory walk, zip archive) needs to thread through,
+// so adding a new flag doesn't mean adding a new positional parameter
+// everywhere.
+type convertOptions struct {
+	parallelism         int
+	maxWidth, maxHeight int
+	encoder             jpegenc.Encoder
+	encOpts             jpegenc.Options
+	pool                *pool
+}
+
 const (
 	program = "jpeger"
 	version = "0.3.0"
@@ -27,26 +49,63 @@ const (
 	failure = 1
 
 	jpegQuality = 90
+
+	parallelEnv = "JPEGER_PARALLEL"
+)
+
+var (
+	logger *log.Logger
+	logMu  sync.Mutex
+
+	jFlag         = flag.Int("j", defaultParallelism(), "number of workers to convert files concurrently (env JPEGER_PARALLEL)")
+	maxWidthFlag  = flag.Int("max-width", 0, "maximum output width; wider images are scaled down to fit (0 = unlimited)")
+	maxHeightFlag = flag.Int("max-height", 0, "maximum output height; taller images are scaled down to fit (0 = unlimited)")
+	thumbnailFlag = flag.String("thumbnail", "", "shorthand for -max-width and -max-height, e.g. -thumbnail 300x300")
+
+	watchFlag         = flag.Bool("watch", false, "keep running and convert new files as they appear under the source directory")
+	watchPollFlag     = flag.Bool("watch-poll", false, "use polling instead of filesystem events, for sources like Windows network shares where inotify-like events are unreliable")
+	watchIntervalFlag = flag.Duration("watch-poll-interval", 2*time.Second, "polling interval used in -watch-poll mode")
+
+	qualityFlag     = flag.Int("quality", jpegQuality, "JPEG quality (1-100)")
+	subsampleFlag   = flag.String("subsample", string(jpegenc.Subsample420), "chroma subsampling: 4:4:4, 4:2:2, or 4:2:0 (only honored by the libjpeg build)")
+	progressiveFlag = flag.Bool("progressive", false, "write progressive JPEGs (only honored by the libjpeg build)")
+	optimizeFlag    = flag.Bool("optimize", false, "optimize Huffman coding tables (only honored by the libjpeg build)")
 )
 
-var logger *log.Logger
+// logf is a concurrency-safe wrapper around logger.Printf; workers call it
+// from multiple goroutines, so plain logger.Printf interleaves lines.
+func logf(format string, args ...interface{}) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logger.Printf(format, args...)
+}
+
+func defaultParallelism() int {
+	if v := os.Getenv(parallelEnv); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
 
-func processImage(data io.ReadCloser) (*bytes.Buffer, error) {
+func processImage(data io.ReadCloser, opts convertOptions) (*bytes.Buffer, error) {
 	im, format, err := image.Decode(data)
 	if err != nil {
 		return nil, fmt.Errorf("image.Decode: %w", err)
 	}
-	logger.Printf("    %s %v", format, im.Bounds())
+	logf("    %s %v", format, im.Bounds())
 
-	buf := new(bytes.Buffer)
-	options := &jpeg.Options{Quality: jpegQuality}
-	if err := jpeg.Encode(buf, im, options); err != nil {
-		return nil, fmt.Errorf("jpeg.Encode: %w", err)
+	im = resizeToFit(im, opts.maxWidth, opts.maxHeight)
+
+	buf, err := opts.encoder.Encode(im, opts.encOpts)
+	if err != nil {
+		return nil, fmt.Errorf("encoder.Encode: %w", err)
 	}
 	return buf, nil
 }
 
-func processImageFile(srcPath, destPath string) error {
+func processImageFile(srcPath, destPath string, opts convertOptions) error {
 	r, err := os.Open(srcPath)
 	if err != nil {
 		return fmt.Errorf("os.Open: %w", err)
@@ -59,7 +118,7 @@ func processImageFile(srcPath, destPath string) error {
 	}
 	defer w.Close()
 
-	buf, err := processImage(r)
+	buf, err := processImage(r, opts)
 	if err != nil {
 		return fmt.Errorf("processImage: %w", err)
 	}
@@ -71,21 +130,32 @@ func processImageFile(srcPath, destPath string) error {
 	return nil
 }
 
-func processZipItem(zf *zip.File) (*bytes.Buffer, error) {
+func processZipItem(zf *zip.File, opts convertOptions) (*bytes.Buffer, error) {
 	rc, err := zf.Open()
 	if err != nil {
 		return nil, fmt.Errorf("zf.Open: %w", err)
 	}
 	defer rc.Close()
 
-	buf, err := processImage(rc)
+	buf, err := processImage(rc, opts)
 	if err != nil {
 		return nil, fmt.Errorf("processImage: %w", err)
 	}
 	return buf, nil
 }
 
-func convertZipItems(srcPath, destPath string) error {
+// zipItemResult carries the outcome of converting a single zip.File back to
+// the goroutine that owns the zip.Writer; each result is written into its
+// own slot of a pre-sized slice, so output order matches input order
+// regardless of completion order.
+type zipItemResult struct {
+	name       string
+	outputName string
+	buf        *bytes.Buffer
+	err        error
+}
+
+func convertZipItems(srcPath, destPath string, opts convertOptions) error {
 	r, err := zip.OpenReader(srcPath)
 	if err != nil {
 		return fmt.Errorf("zip.OpenReader: %w", err)
@@ -95,23 +165,42 @@ func convertZipItems(srcPath, destPath string) error {
 	zipbuf := new(bytes.Buffer)
 	w := zip.NewWriter(zipbuf)
 
-	for _, f := range r.File {
-		logger.Printf("  %s\n", f.Name)
-		buf, err := processZipItem(f)
-		if err != nil {
+	results := make([]zipItemResult, len(r.File))
+
+	var wg sync.WaitGroup
+	for idx, f := range r.File {
+		idx, f := idx, f
+		wg.Add(1)
+		opts.pool.submit(func() {
+			defer wg.Done()
+			logf("  %s\n", f.Name)
+			buf, err := processZipItem(f, opts)
+			stem, _ := splitExt(f.Name)
+			results[idx] = zipItemResult{
+				name:       f.Name,
+				outputName: fmt.Sprintf("%s.jpg", stem),
+				buf:        buf,
+				err:        err,
+			}
+		})
+	}
+	wg.Wait()
+
+	// w.Create must be called from a single goroutine, so the writes happen
+	// here, serialized, after every entry has finished decoding.
+	for _, res := range results {
+		if res.err != nil {
 			// エラーでも中断せずに継続する
-			logger.Printf("processZipFile: %v\n", err)
-			logger.Printf("skip processing %s\n", f.Name)
+			logf("processZipFile: %v\n", res.err)
+			logf("skip processing %s\n", res.name)
 			continue
 		}
-		stem, _ := splitExt(f.Name)
-		outputName := fmt.Sprintf("%s.jpg", stem)
-		logger.Printf("  => %s\n", outputName)
-		wf, err := w.Create(outputName)
+		logf("  => %s\n", res.outputName)
+		wf, err := w.Create(res.outputName)
 		if err != nil {
 			return fmt.Errorf("w.Create: %w", err)
 		}
-		if _, err := wf.Write(buf.Bytes()); err != nil {
+		if _, err := wf.Write(res.buf.Bytes()); err != nil {
 			return fmt.Errorf("wf.Write: %w", err)
 		}
 	}
@@ -150,6 +239,13 @@ func decodePathStrings(src string) (string, error) {
 }
 
 func resolveDestPath(srcPath string) string {
+	// .tar.gz is a double extension that splitExt can't see past, so it
+	// needs handling before falling into the single-extension switch below.
+	if strings.HasSuffix(strings.ToLower(srcPath), ".tar.gz") {
+		stem := srcPath[:len(srcPath)-len(".tar.gz")]
+		return fmt.Sprintf("%s_jpeg.tar.gz", stem)
+	}
+
 	srcStem, srcExt := splitExt(srcPath)
 	switch strings.ToLower(srcExt) {
 	case ".png":
@@ -163,6 +259,15 @@ func resolveDestPath(srcPath string) string {
 	}
 }
 
+// mirrorPath computes, for a file found under srcRoot, the path it should
+// be written to under destRoot: the directory structure is mirrored as-is,
+// while the leaf name goes through resolveDestPath (png -> jpg, etc).
+func mirrorPath(srcRoot, destRoot, child string) string {
+	parent, childName := filepath.Split(child)
+	destParent := strings.Replace(parent, srcRoot, destRoot, 1)
+	return filepath.Join(destParent, resolveDestPath(childName))
+}
+
 func copyFile(src, dest string) error {
 	r, err := os.Open(src)
 	if err != nil {
@@ -182,16 +287,41 @@ func copyFile(src, dest string) error {
 	return nil
 }
 
-func runUnit(srcPath, destPath string, skipJpeg bool) error {
+// isArchivePath reports whether runUnit will dispatch srcPath to an archive
+// handler (convertZipItems/convertTarItems) rather than processing it
+// directly, so callers can decide how to bound its concurrency.
+func isArchivePath(srcPath string) bool {
+	lower := strings.ToLower(srcPath)
+	if strings.HasSuffix(lower, ".tar.gz") {
+		return true
+	}
+	switch filepath.Ext(lower) {
+	case ".zip", ".tar", ".tgz":
+		return true
+	default:
+		return false
+	}
+}
+
+func runUnit(srcPath, destPath string, skipJpeg bool, opts convertOptions) error {
+	// .tar.gz is a double extension that splitExt can't see past, so it
+	// needs handling before dispatching on the single extension below.
+	if strings.HasSuffix(strings.ToLower(srcPath), ".tar.gz") {
+		if err := convertTarItems(srcPath, destPath, opts, true); err != nil {
+			return fmt.Errorf("convertTarItems: %w", err)
+		}
+		return nil
+	}
+
 	_, srcExt := splitExt(srcPath)
 	switch strings.ToLower(srcExt) {
 	case ".png":
-		if err := processImageFile(srcPath, destPath); err != nil {
+		if err := processImageFile(srcPath, destPath, opts); err != nil {
 			return fmt.Errorf("processImageFile: %w", err)
 		}
 	case ".jpg", ".jpeg":
 		if skipJpeg {
-			logger.Printf("skip processing jpeg file: %s\n", srcPath)
+			logf("skip processing jpeg file: %s\n", srcPath)
 			return nil
 		}
 
@@ -200,16 +330,44 @@ func runUnit(srcPath, destPath string, skipJpeg bool) error {
 		}
 
 	case ".zip":
-		if err := convertZipItems(srcPath, destPath); err != nil {
+		if err := convertZipItems(srcPath, destPath, opts); err != nil {
 			return fmt.Errorf("convertZipItems: %w", err)
 		}
+	case ".tar":
+		if err := convertTarItems(srcPath, destPath, opts, false); err != nil {
+			return fmt.Errorf("convertTarItems: %w", err)
+		}
+	case ".tgz":
+		if err := convertTarItems(srcPath, destPath, opts, true); err != nil {
+			return fmt.Errorf("convertTarItems: %w", err)
+		}
 	default:
 		return fmt.Errorf("unsupported file type: %s", srcExt)
 	}
 	return nil
 }
 
+// parseThumbnail parses a "WxH" shorthand such as "300x300" into its
+// component dimensions.
+func parseThumbnail(s string) (w, h int, err error) {
+	parts := strings.SplitN(s, "x", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid size %q, want WxH", s)
+	}
+	w, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width in %q: %w", s, err)
+	}
+	h, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid height in %q: %w", s, err)
+	}
+	return w, h, nil
+}
+
 func run() int {
+	flag.Parse()
+
 	logFile, err := os.OpenFile(logName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Fatal(err)
@@ -222,12 +380,62 @@ func run() int {
 	logger.Printf("<<< %s %s %s/%s >>>\n", program, version, runtime.GOOS, runtime.GOARCH)
 	logger.Printf("args: %v\n", os.Args)
 
-	if len(os.Args) < 2 {
+	parallelism := *jFlag
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	logger.Printf("parallelism: %d\n", parallelism)
+
+	maxWidth, maxHeight := *maxWidthFlag, *maxHeightFlag
+	if *thumbnailFlag != "" {
+		w, h, err := parseThumbnail(*thumbnailFlag)
+		if err != nil {
+			logger.Printf("parseThumbnail: %s\n", err)
+			return failure
+		}
+		maxWidth, maxHeight = w, h
+	}
+
+	quality := *qualityFlag
+	if quality < 1 || quality > 100 {
+		logger.Printf("-quality must be between 1 and 100, got %d\n", quality)
+		return failure
+	}
+
+	subsample := jpegenc.Subsampling(*subsampleFlag)
+	switch subsample {
+	case jpegenc.Subsample444, jpegenc.Subsample422, jpegenc.Subsample420:
+		// ok
+	default:
+		logger.Printf("-subsample must be one of %s, %s, %s; got %q\n",
+			jpegenc.Subsample444, jpegenc.Subsample422, jpegenc.Subsample420, *subsampleFlag)
+		return failure
+	}
+
+	opts := convertOptions{
+		parallelism: parallelism,
+		maxWidth:    maxWidth,
+		maxHeight:   maxHeight,
+		encoder:     jpegenc.New(),
+		encOpts: jpegenc.Options{
+			Quality:        quality,
+			Subsampling:    subsample,
+			Progressive:    *progressiveFlag,
+			OptimizeCoding: *optimizeFlag,
+		},
+		pool: newPool(parallelism),
+	}
+	defer opts.pool.close()
+	logger.Printf("maxWidth: %d, maxHeight: %d\n", opts.maxWidth, opts.maxHeight)
+	logger.Printf("quality: %d, subsample: %s, progressive: %v, optimize: %v\n",
+		opts.encOpts.Quality, opts.encOpts.Subsampling, opts.encOpts.Progressive, opts.encOpts.OptimizeCoding)
+
+	if flag.NArg() < 1 {
 		logger.Println("too few arguments")
 		return failure
 	}
 
-	srcPath := os.Args[1]
+	srcPath := flag.Arg(0)
 	stat, err := os.Stat(srcPath)
 	if os.IsNotExist(err) {
 		logger.Printf("%s: no such file or directory\n", srcPath)
@@ -241,13 +449,37 @@ func run() int {
 	destPath := resolveDestPath(srcPath)
 	logger.Printf("dest: %s\n", destPath)
 
+	if *watchFlag {
+		if !srcIsDir {
+			logger.Printf("%s: -watch requires a directory\n", srcPath)
+			return failure
+		}
+		if err := os.MkdirAll(destPath, 0755); err != nil {
+			logger.Printf("os.MkdirAll: %s\n", err)
+			return failure
+		}
+		return runWatch(srcPath, destPath, opts, *watchPollFlag, *watchIntervalFlag)
+	}
+
 	if srcIsDir {
 		logger.Printf("start to walk on: %s\n", srcPath)
-		if err := filepath.Walk(srcPath, func(child string, info fs.FileInfo, err error) error {
+
+		// Archives are dispatched through a goroutine bounded by this
+		// semaphore rather than opts.pool itself: a zip/tar found during the
+		// walk calls back into opts.pool for its own entries and waits on
+		// them, so submitting the archive as a pool job too could leave
+		// every pool worker blocked waiting on itself with none free to pick
+		// up the entries it's waiting for. Plain files skip this semaphore
+		// and go straight into opts.pool, so every actual encode - whether
+		// it's a loose file or a zip/tar entry - draws from the same -j
+		// budget instead of the two stacking to roughly double it.
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		walkErr := filepath.Walk(srcPath, func(child string, info fs.FileInfo, err error) error {
 			if err != nil {
 				return fmt.Errorf("path %s; err: %w", child, err)
 			}
-			logger.Printf("  | %s\n", child)
+			logf("  | %s\n", child)
 
 			if info.IsDir() {
 				destDir := strings.Replace(child, srcPath, destPath, 1)
@@ -257,27 +489,43 @@ func run() int {
 				return nil
 			}
 
-			parent, childName := filepath.Split(child)
-			destName := resolveDestPath(childName)
-			destParent := strings.Replace(parent, srcPath, destPath, 1)
-			dest := filepath.Join(destParent, destName)
-			logger.Printf("  | dest: %s\n", dest)
-
-			// jpeg は単にコピー
-			if err := runUnit(child, dest, false); err != nil {
-				logger.Printf("runUnit: %s\n", err)
-				// 単発の処理でエラーが発生しても止めずに続行
+			dest := mirrorPath(srcPath, destPath, child)
+			logf("  | dest: %s\n", dest)
+
+			wg.Add(1)
+			if isArchivePath(child) {
+				sem <- struct{}{}
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					if err := runUnit(child, dest, false, opts); err != nil {
+						logf("runUnit: %s\n", err)
+						// 単発の処理でエラーが発生しても止めずに続行
+					}
+				}()
+			} else {
+				// jpeg は単にコピー
+				opts.pool.submit(func() {
+					defer wg.Done()
+					if err := runUnit(child, dest, false, opts); err != nil {
+						logf("runUnit: %s\n", err)
+						// 単発の処理でエラーが発生しても止めずに続行
+					}
+				})
 			}
 			return nil
+		})
+
+		wg.Wait()
 
-		}); err != nil {
-			logger.Printf("filePath.Walk: %s\n", err)
+		if walkErr != nil {
+			logger.Printf("filePath.Walk: %s\n", walkErr)
 			return failure
 		}
 
 	} else {
 		// jpeg は無視
-		if err := runUnit(srcPath, destPath, true); err != nil {
+		if err := runUnit(srcPath, destPath, true, opts); err != nil {
 			logger.Printf("runUnit: %s\n", err)
 			return failure
 		}
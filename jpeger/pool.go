@@ -0,0 +1,39 @@
+package main
+
+import "sync"
+
+// pool is a bounded worker pool shared across an entire run by every
+// archive (zip/tar) conversion, so that entries from several archives
+// being processed at once still decode through a single set of -j
+// workers instead of each archive starting a fresh pool of its own and
+// multiplying total concurrency well beyond what -j asked for.
+type pool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func newPool(n int) *pool {
+	p := &pool{jobs: make(chan func())}
+	for i := 0; i < n; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit blocks until a worker is free to run job.
+func (p *pool) submit(job func()) {
+	p.jobs <- job
+}
+
+// close stops accepting jobs and waits for every worker to drain. It must
+// only be called once all submit calls have returned.
+func (p *pool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
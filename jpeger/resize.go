@@ -0,0 +1,179 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// lanczosSupport is the number of source samples (in each direction) that
+// contribute to a single destination pixel under the Lanczos3 kernel.
+const lanczosSupport = 3.0
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func lanczos(x float64) float64 {
+	if x < -lanczosSupport || x > lanczosSupport {
+		return 0
+	}
+	return sinc(x) * sinc(x/lanczosSupport)
+}
+
+// filterWeight is one source sample contributing to a destination pixel,
+// along with its already-normalized weight.
+type filterWeight struct {
+	index  int
+	weight float64
+}
+
+// filterWeights precomputes, for every destination index along one axis,
+// the source indices and weights that are blended to produce it. When
+// downscaling (dstSize < srcSize) the kernel is widened by 1/scale so more
+// neighbouring source samples are averaged in, which is what keeps a
+// Lanczos downscale from aliasing.
+func filterWeights(srcSize, dstSize int) [][]filterWeight {
+	scale := float64(dstSize) / float64(srcSize)
+	filterScale := 1.0
+	if scale < 1 {
+		filterScale = 1 / scale
+	}
+	support := lanczosSupport * filterScale
+
+	weights := make([][]filterWeight, dstSize)
+	for dst := 0; dst < dstSize; dst++ {
+		center := (float64(dst)+0.5)/scale - 0.5
+		start := int(math.Floor(center - support))
+		end := int(math.Ceil(center + support))
+
+		var ws []filterWeight
+		var sum float64
+		for s := start; s <= end; s++ {
+			w := lanczos((float64(s) - center) / filterScale)
+			if w == 0 {
+				continue
+			}
+			idx := s
+			switch {
+			case idx < 0:
+				idx = 0
+			case idx >= srcSize:
+				idx = srcSize - 1
+			}
+			ws = append(ws, filterWeight{index: idx, weight: w})
+			sum += w
+		}
+		if sum != 0 {
+			for i := range ws {
+				ws[i].weight /= sum
+			}
+		}
+		weights[dst] = ws
+	}
+	return weights
+}
+
+func clampUint8(v float64) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// resizeRGBA resamples src to dstW x dstH using a separable Lanczos3
+// filter: a horizontal pass followed by a vertical pass, each built from
+// precomputed filter weights.
+func resizeRGBA(src *image.RGBA, dstW, dstH int) *image.RGBA {
+	srcB := src.Bounds()
+	srcW, srcH := srcB.Dx(), srcB.Dy()
+
+	hWeights := filterWeights(srcW, dstW)
+	tmp := image.NewRGBA(image.Rect(0, 0, dstW, srcH))
+	for y := 0; y < srcH; y++ {
+		for x := 0; x < dstW; x++ {
+			var r, g, b, a float64
+			for _, fw := range hWeights[x] {
+				pr, pg, pb, pa := src.At(srcB.Min.X+fw.index, srcB.Min.Y+y).RGBA()
+				r += float64(pr>>8) * fw.weight
+				g += float64(pg>>8) * fw.weight
+				b += float64(pb>>8) * fw.weight
+				a += float64(pa>>8) * fw.weight
+			}
+			tmp.SetRGBA(x, y, color.RGBA{clampUint8(r), clampUint8(g), clampUint8(b), clampUint8(a)})
+		}
+	}
+
+	vWeights := filterWeights(srcH, dstH)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for x := 0; x < dstW; x++ {
+		for y := 0; y < dstH; y++ {
+			var r, g, b, a float64
+			for _, fw := range vWeights[y] {
+				pr, pg, pb, pa := tmp.At(x, fw.index).RGBA()
+				r += float64(pr>>8) * fw.weight
+				g += float64(pg>>8) * fw.weight
+				b += float64(pb>>8) * fw.weight
+				a += float64(pa>>8) * fw.weight
+			}
+			dst.SetRGBA(x, y, color.RGBA{clampUint8(r), clampUint8(g), clampUint8(b), clampUint8(a)})
+		}
+	}
+	return dst
+}
+
+// fitSize computes the largest w x h that fits inside maxW x maxH while
+// preserving srcW x srcH's aspect ratio, without ever upscaling. A
+// non-positive maxW or maxH means that axis is unconstrained.
+func fitSize(srcW, srcH, maxW, maxH int) (w, h int) {
+	if maxW <= 0 {
+		maxW = srcW
+	}
+	if maxH <= 0 {
+		maxH = srcH
+	}
+	if srcW <= maxW && srcH <= maxH {
+		return srcW, srcH
+	}
+
+	scale := math.Min(float64(maxW)/float64(srcW), float64(maxH)/float64(srcH))
+	w = int(math.Round(float64(srcW) * scale))
+	h = int(math.Round(float64(srcH) * scale))
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// resizeToFit scales im down to fit inside maxWidth x maxHeight, preserving
+// aspect ratio and never upscaling. maxWidth and maxHeight <= 0 leave that
+// axis unconstrained; both <= 0 returns im unchanged.
+func resizeToFit(im image.Image, maxWidth, maxHeight int) image.Image {
+	if maxWidth <= 0 && maxHeight <= 0 {
+		return im
+	}
+
+	b := im.Bounds()
+	dstW, dstH := fitSize(b.Dx(), b.Dy(), maxWidth, maxHeight)
+	if dstW == b.Dx() && dstH == b.Dy() {
+		return im
+	}
+
+	rgba, ok := im.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, im, b.Min, draw.Src)
+	}
+	return resizeRGBA(rgba, dstW, dstH)
+}
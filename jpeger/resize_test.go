@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	cases := []struct {
+		name                   string
+		srcW, srcH, maxW, maxH int
+		wantW, wantH           int
+	}{
+		{"fits already", 100, 100, 200, 200, 100, 100},
+		{"downscale preserves aspect", 400, 200, 100, 100, 100, 50},
+		{"never upscales", 50, 50, 200, 200, 50, 50},
+		{"width unconstrained", 400, 200, 0, 100, 200, 100},
+		{"height unconstrained", 400, 200, 100, 0, 100, 50},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w, h := fitSize(c.srcW, c.srcH, c.maxW, c.maxH)
+			if w != c.wantW || h != c.wantH {
+				t.Errorf("fitSize(%d, %d, %d, %d) = %d, %d; want %d, %d",
+					c.srcW, c.srcH, c.maxW, c.maxH, w, h, c.wantW, c.wantH)
+			}
+		})
+	}
+}
+
+func TestParseThumbnail(t *testing.T) {
+	w, h, err := parseThumbnail("300x200")
+	if err != nil {
+		t.Fatalf("parseThumbnail: %s", err)
+	}
+	if w != 300 || h != 200 {
+		t.Errorf("parseThumbnail(\"300x200\") = %d, %d; want 300, 200", w, h)
+	}
+
+	invalid := []string{"300", "300x", "x200", "300xabc", "abcx200"}
+	for _, s := range invalid {
+		if _, _, err := parseThumbnail(s); err == nil {
+			t.Errorf("parseThumbnail(%q): want error, got nil", s)
+		}
+	}
+}
+
+func TestResizeRGBADownscale(t *testing.T) {
+	// A 4x4 solid-color image downscaled by half should stay that same
+	// color: Lanczos weights sum to 1, so a uniform source has no way to
+	// introduce ringing.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	want := color.RGBA{R: 200, G: 100, B: 50, A: 255}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetRGBA(x, y, want)
+		}
+	}
+
+	dst := resizeRGBA(src, 2, 2)
+	b := dst.Bounds()
+	if b.Dx() != 2 || b.Dy() != 2 {
+		t.Fatalf("resizeRGBA size = %dx%d; want 2x2", b.Dx(), b.Dy())
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			got := dst.RGBAAt(x, y)
+			if got != want {
+				t.Errorf("pixel (%d, %d) = %+v; want %+v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestResizeToFitNoopWhenUnconstrained(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if got := resizeToFit(src, 0, 0); got != image.Image(src) {
+		t.Errorf("resizeToFit with maxWidth=maxHeight=0 should return im unchanged")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// tarEntry is a regular-file entry read out of the source archive, kept in
+// memory so it can be handed to a worker for decoding; archive/tar.Reader
+// is forward-only, so entries can't be re-read the way zip.File allows.
+type tarEntry struct {
+	header *tar.Header
+	data   []byte
+}
+
+// tarItemResult carries the outcome of converting a tarEntry back to the
+// goroutine that owns the tar.Writer, alongside the header needed to build
+// the output entry.
+type tarItemResult struct {
+	header *tar.Header
+	buf    *bytes.Buffer
+	err    error
+}
+
+func convertTarItems(srcPath, destPath string, opts convertOptions, gzipped bool) error {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if gzipped {
+		gzr, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+
+	var entries []tarEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tr.Next: %w", err)
+		}
+
+		// ディレクトリ・シンボリックリンク・キャラクタデバイスは読み飛ばす
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("io.ReadAll: %w", err)
+		}
+		entries = append(entries, tarEntry{header: hdr, data: data})
+	}
+
+	results := make([]tarItemResult, len(entries))
+
+	var wg sync.WaitGroup
+	for idx, e := range entries {
+		idx, e := idx, e
+		wg.Add(1)
+		opts.pool.submit(func() {
+			defer wg.Done()
+			logf("  %s\n", e.header.Name)
+			buf, err := processImage(io.NopCloser(bytes.NewReader(e.data)), opts)
+			results[idx] = tarItemResult{header: e.header, buf: buf, err: err}
+		})
+	}
+	wg.Wait()
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	defer out.Close()
+
+	var gzw *gzip.Writer
+	var w io.Writer = out
+	if gzipped {
+		gzw = gzip.NewWriter(out)
+		w = gzw
+	}
+
+	tw := tar.NewWriter(w)
+
+	// tar.Writer must be driven from a single goroutine, so the writes
+	// happen here, serialized, after every entry has finished decoding.
+	for _, res := range results {
+		if res.err != nil {
+			logf("processImage: %v\n", res.err)
+			logf("skip processing %s\n", res.header.Name)
+			continue
+		}
+
+		stem, _ := splitExt(res.header.Name)
+		outHeader := &tar.Header{
+			Name:     fmt.Sprintf("%s.jpg", stem),
+			Typeflag: tar.TypeReg,
+			Mode:     res.header.Mode,
+			Size:     int64(res.buf.Len()),
+			ModTime:  res.header.ModTime,
+			Uname:    res.header.Uname,
+			Gname:    res.header.Gname,
+		}
+		logf("  => %s\n", outHeader.Name)
+		if err := tw.WriteHeader(outHeader); err != nil {
+			return fmt.Errorf("tw.WriteHeader: %w", err)
+		}
+		if _, err := tw.Write(res.buf.Bytes()); err != nil {
+			return fmt.Errorf("tw.Write: %w", err)
+		}
+	}
+
+	// tw.Close writes the tar trailer and gzw.Close flushes the gzip
+	// footer; both are real writes that can fail (e.g. disk full), so
+	// check them explicitly instead of discarding the error in a defer.
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("tw.Close: %w", err)
+	}
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			return fmt.Errorf("gzw.Close: %w", err)
+		}
+	}
+
+	return nil
+}
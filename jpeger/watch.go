@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	stateFileName = ".jpeger-state"
+	watchDebounce = 500 * time.Millisecond
+)
+
+// watchState is the sidecar record of files already converted by watch
+// mode, keyed by source path, so that restarting -watch doesn't re-encode
+// everything under the source directory.
+type watchState struct {
+	Processed map[string]time.Time `json:"processed"`
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &watchState{Processed: map[string]time.Time{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var st watchState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if st.Processed == nil {
+		st.Processed = map[string]time.Time{}
+	}
+	return &st, nil
+}
+
+func (s *watchState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+	return nil
+}
+
+func (s *watchState) isStale(path string, mtime time.Time) bool {
+	prev, ok := s.Processed[path]
+	return !ok || mtime.After(prev)
+}
+
+// debounce coalesces bursts of events for the same path into a single
+// event, delay after the last one seen, so a PNG that's still being
+// written to isn't picked up mid-write.
+func debounce(in <-chan string, delay time.Duration) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+
+		var mu sync.Mutex
+		timers := make(map[string]*time.Timer)
+		var wg sync.WaitGroup
+
+		for path := range in {
+			mu.Lock()
+			if t, ok := timers[path]; ok {
+				// Stop reports whether it prevented the function from
+				// running; if so, that Add is never balanced by the
+				// function's own wg.Done, so balance it here instead.
+				if t.Stop() {
+					wg.Done()
+				}
+			}
+			p := path
+			wg.Add(1)
+			timers[p] = time.AfterFunc(delay, func() {
+				defer wg.Done()
+				out <- p
+				mu.Lock()
+				delete(timers, p)
+				mu.Unlock()
+			})
+			mu.Unlock()
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+// watchFsnotify watches srcPath and forwards affected file paths to out:
+// directories are watched as they're found, including ones created after
+// startup, and every file already present under srcPath is also sent to
+// out once up front so a restart picks up files that landed while jpeger
+// wasn't running -- the same first-pass behavior watchPoll gets for free
+// from starting with an empty seen map. The returned closer must be
+// closed by the caller once done.
+func watchFsnotify(srcPath string, out chan<- string) (io.Closer, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("fsnotify.NewWatcher: %w", err)
+	}
+
+	var existing []string
+	if err := filepath.Walk(srcPath, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("path %s; err: %w", p, err)
+		}
+		if info.IsDir() {
+			if err := w.Add(p); err != nil {
+				return fmt.Errorf("w.Add: %w", err)
+			}
+			return nil
+		}
+		existing = append(existing, p)
+		return nil
+	}); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("filepath.Walk: %w", err)
+	}
+
+	// Sent from a goroutine, since out isn't drained yet while the caller
+	// is still setting up its consumer.
+	go func() {
+		for _, p := range existing {
+			out <- p
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+
+				if ev.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						if err := watchNewDir(w, ev.Name, out); err != nil {
+							logf("watchNewDir: %s\n", err)
+						}
+						continue
+					}
+				}
+
+				if ev.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+					out <- ev.Name
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logf("fsnotify: %s\n", err)
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// watchNewDir adds a directory created after startup to w, along with any
+// subdirectories already inside it, and forwards every regular file already
+// present under it to out. Without this, a folder moved in from elsewhere
+// in one go (rather than built up file-by-file inside srcPath) would be
+// watched from then on but its existing contents would never be converted.
+func watchNewDir(w *fsnotify.Watcher, dir string, out chan<- string) error {
+	return filepath.Walk(dir, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("path %s; err: %w", p, err)
+		}
+		if info.IsDir() {
+			if err := w.Add(p); err != nil {
+				return fmt.Errorf("w.Add: %w", err)
+			}
+			return nil
+		}
+		out <- p
+		return nil
+	})
+}
+
+// watchPoll is the polling fallback for filesystems (e.g. Windows network
+// shares) where CREATE/CLOSE_WRITE-like events aren't reliably delivered.
+// It re-walks srcPath every interval and reports files whose mtime has
+// moved forward since the previous pass.
+func watchPoll(srcPath string, interval time.Duration, out chan<- string) io.Closer {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		seen := make(map[string]time.Time)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				filepath.Walk(srcPath, func(p string, info fs.FileInfo, err error) error {
+					if err != nil || info.IsDir() {
+						return nil
+					}
+					if mtime, ok := seen[p]; !ok || info.ModTime().After(mtime) {
+						seen[p] = info.ModTime()
+						out <- p
+					}
+					return nil
+				})
+			}
+		}
+	}()
+	return pollCloser{stop: stop, done: done}
+}
+
+// pollCloser lets runWatch stop the polling goroutine with the same Close
+// signature fsnotify.Watcher exposes.
+type pollCloser struct {
+	stop chan struct{}
+	done <-chan struct{}
+}
+
+func (c pollCloser) Close() error {
+	close(c.stop)
+	<-c.done
+	return nil
+}
+
+// runWatch implements -watch: it keeps converting files that appear under
+// srcPath, mirroring them into destPath the same way the one-shot
+// directory walk does, until the process is interrupted.
+func runWatch(srcPath, destPath string, opts convertOptions, forcePoll bool, pollInterval time.Duration) int {
+	statePath := filepath.Join(destPath, stateFileName)
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		logger.Printf("loadWatchState: %s\n", err)
+		return failure
+	}
+
+	events := make(chan string)
+
+	var closer io.Closer
+	if forcePoll {
+		logger.Printf("watching %s (polling every %s)\n", srcPath, pollInterval)
+		closer = watchPoll(srcPath, pollInterval, events)
+	} else {
+		logger.Printf("watching %s (fsnotify)\n", srcPath)
+		w, err := watchFsnotify(srcPath, events)
+		if err != nil {
+			logger.Printf("watchFsnotify: %s, falling back to polling\n", err)
+			closer = watchPoll(srcPath, pollInterval, events)
+		} else {
+			closer = w
+		}
+	}
+	defer closer.Close()
+
+	for path := range debounce(events, watchDebounce) {
+		handleWatchEvent(path, srcPath, destPath, opts, state, statePath)
+	}
+	return success
+}
+
+func handleWatchEvent(path, srcPath, destPath string, opts convertOptions, state *watchState, statePath string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		// ファイルが既に削除・リネームされていた場合は無視する
+		return
+	}
+	if info.IsDir() {
+		return
+	}
+
+	if !state.isStale(path, info.ModTime()) {
+		return
+	}
+
+	dest := mirrorPath(srcPath, destPath, path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		logf("os.MkdirAll: %s\n", err)
+		return
+	}
+
+	logf("  | %s\n", path)
+	logf("  | dest: %s\n", dest)
+	if err := runUnit(path, dest, false, opts); err != nil {
+		logf("runUnit: %s\n", err)
+		return
+	}
+
+	state.Processed[path] = info.ModTime()
+	if err := state.save(statePath); err != nil {
+		logf("state.save: %s\n", err)
+	}
+}
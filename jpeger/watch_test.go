@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestDebounceCoalescesBursts(t *testing.T) {
+	in := make(chan string)
+	out := debounce(in, 20*time.Millisecond)
+
+	go func() {
+		in <- "a.png"
+		in <- "a.png"
+		in <- "a.png"
+		close(in)
+	}()
+
+	select {
+	case p, ok := <-out:
+		if !ok {
+			t.Fatal("out closed before delivering a.png")
+		}
+		if p != "a.png" {
+			t.Fatalf("got %q; want a.png", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for debounced event")
+	}
+
+	select {
+	case p, ok := <-out:
+		if ok {
+			t.Fatalf("got extra event %q; burst should have coalesced into one", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for out to close")
+	}
+}
+
+func TestDebounceKeepsDistinctPaths(t *testing.T) {
+	in := make(chan string)
+	out := debounce(in, 20*time.Millisecond)
+
+	go func() {
+		in <- "a.png"
+		in <- "b.png"
+		close(in)
+	}()
+
+	seen := map[string]bool{}
+	for p := range out {
+		seen[p] = true
+	}
+	if !seen["a.png"] || !seen["b.png"] {
+		t.Fatalf("got %v; want both a.png and b.png", seen)
+	}
+}
+
+func TestWatchStateIsStale(t *testing.T) {
+	now := time.Now()
+	st := &watchState{Processed: map[string]time.Time{
+		"a.png": now,
+	}}
+
+	if st.isStale("a.png", now) {
+		t.Error("same mtime as recorded should not be stale")
+	}
+	if st.isStale("a.png", now.Add(-time.Second)) {
+		t.Error("older mtime than recorded should not be stale")
+	}
+	if !st.isStale("a.png", now.Add(time.Second)) {
+		t.Error("newer mtime than recorded should be stale")
+	}
+	if !st.isStale("b.png", now) {
+		t.Error("path never recorded should be stale")
+	}
+}
+
+func TestWatchNewDirForwardsExistingFiles(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(filepath.Join(sub, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{
+		filepath.Join(sub, "a.png"),
+		filepath.Join(sub, "nested", "b.png"),
+	} {
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	out := make(chan string, 2)
+	if err := watchNewDir(w, sub, out); err != nil {
+		t.Fatalf("watchNewDir: %s", err)
+	}
+	close(out)
+
+	var got []string
+	for p := range out {
+		got = append(got, p)
+	}
+	want := []string{filepath.Join(sub, "a.png"), filepath.Join(sub, "nested", "b.png")}
+	if len(got) != len(want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if g == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %q in %v", w, got)
+		}
+	}
+}